@@ -0,0 +1,481 @@
+// Package session provides types for tracking and using sessions server side.
+package session
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/mongodb/mongo-go-driver/bson"
+	"github.com/mongodb/mongo-go-driver/core/connection"
+	"github.com/mongodb/mongo-go-driver/core/description"
+	"github.com/mongodb/mongo-go-driver/core/readconcern"
+	"github.com/mongodb/mongo-go-driver/core/readpref"
+	"github.com/mongodb/mongo-go-driver/core/uuid"
+	"github.com/mongodb/mongo-go-driver/core/writeconcern"
+)
+
+// Errors returned from ClientSession methods.
+var (
+	ErrSessionEnded               = errors.New("ended session was used")
+	ErrNoTransactStarted          = errors.New("no transaction started")
+	ErrTransactInProgress         = errors.New("transaction already in progress")
+	ErrAbortAfterCommit           = errors.New("cannot call abortTransaction after calling commitTransaction")
+	ErrAbortTwice                 = errors.New("cannot call abortTransaction twice")
+	ErrCommitAfterAbort           = errors.New("cannot call commitTransaction after calling abortTransaction")
+	ErrUnackWCUnsupported         = errors.New("unacknowledged write concern not supported when using transactions")
+	ErrSnapshotWriteNotAllowed    = errors.New("write operations are not allowed on a snapshot session")
+	ErrSnapshotCausalInconsistent = errors.New("causal consistency and snapshot cannot both be enabled for a session")
+	ErrSessionOperationCanceled   = errors.New("session operation canceled before its command could be sent")
+)
+
+// SessionType represents the type of a session, either explicit or implicit.
+type SessionType uint8
+
+// These constants are the valid values for SessionType.
+const (
+	Explicit SessionType = iota
+	Implicit
+)
+
+// state represents the state of the transaction FSM associated with a ClientSession.
+type state uint8
+
+// These constants are the valid values for state.
+const (
+	None state = iota
+	Starting
+	InProgress
+	Committed
+	Aborted
+)
+
+// TransactionOptions represents options that can be used to configure a transaction started by
+// ClientSession.StartTransaction.
+type TransactionOptions struct {
+	ReadConcern     *readconcern.ReadConcern
+	ReadPreference  *readpref.ReadPref
+	WriteConcern    *writeconcern.WriteConcern
+	MaxCommitTimeMS *int64
+}
+
+// TransactionOption is an option used to configure a TransactionOptions.
+type TransactionOption func(*TransactionOptions)
+
+// OptTransactionReadConcern sets the read concern used for the transaction.
+func OptTransactionReadConcern(rc *readconcern.ReadConcern) TransactionOption {
+	return func(opts *TransactionOptions) { opts.ReadConcern = rc }
+}
+
+// OptTransactionReadPreference sets the read preference used for the transaction.
+func OptTransactionReadPreference(rp *readpref.ReadPref) TransactionOption {
+	return func(opts *TransactionOptions) { opts.ReadPreference = rp }
+}
+
+// OptTransactionWriteConcern sets the write concern used for the transaction.
+func OptTransactionWriteConcern(wc *writeconcern.WriteConcern) TransactionOption {
+	return func(opts *TransactionOptions) { opts.WriteConcern = wc }
+}
+
+// OptTransactionMaxCommitTimeMS sets the maxTimeMS sent on commitTransaction.
+func OptTransactionMaxCommitTimeMS(ms int64) TransactionOption {
+	return func(opts *TransactionOptions) { opts.MaxCommitTimeMS = &ms }
+}
+
+// mergeTransactionOptions merges a chain of TransactionOption into a single TransactionOptions,
+// falling back to the session's default options for any field that isn't set.
+func mergeTransactionOptions(defaults *TransactionOptions, opts ...TransactionOption) *TransactionOptions {
+	merged := &TransactionOptions{}
+	if defaults != nil {
+		*merged = *defaults
+	}
+	for _, opt := range opts {
+		if opt == nil {
+			continue
+		}
+		opt(merged)
+	}
+	return merged
+}
+
+// ClientSession represents a logical session used to associate sequential operations made by one
+// application and enable consistency guarantees like causal consistency and retryable writes
+// across those operations.
+type ClientSession struct {
+	ClusterTime      *bson.Document
+	OperationTime    *bson.Timestamp
+	SessionID        *bson.Document
+	SessionType      SessionType
+	Terminated       bool
+	ClientID         uuid.UUID
+	TxnNumber        int64
+	RecoveryToken    *bson.Document
+	PinnedServer     *description.Server
+	PinnedConnection connection.Connection
+
+	pool            *Pool
+	server          *serverSession
+	state           state
+	consistent      bool // causal consistency
+	transactionOpts *TransactionOptions
+	snapshot        bool
+	snapshotTime    *bson.Timestamp
+	monitor         Monitor
+}
+
+// ClientSessionOpt is an option that configures a ClientSession at construction time.
+type ClientSessionOpt func(*ClientSession) error
+
+// OptCausalConsistency enables or disables causal consistency for the session. It is mutually
+// exclusive with OptSnapshot.
+func OptCausalConsistency(b bool) ClientSessionOpt {
+	return func(sess *ClientSession) error {
+		if b && sess.snapshot {
+			return ErrSnapshotCausalInconsistent
+		}
+		sess.consistent = b
+		return nil
+	}
+}
+
+// OptSnapshot enables or disables snapshot reads for the session. When enabled, the session pins
+// the atClusterTime returned by the first read it performs and applies it as the snapshot read
+// concern to every later read, so all reads in the session observe a single point-in-time
+// snapshot of the data. Writes are not allowed on a snapshot session. It is mutually exclusive
+// with OptCausalConsistency.
+func OptSnapshot(b bool) ClientSessionOpt {
+	return func(sess *ClientSession) error {
+		if b && sess.consistent {
+			return ErrSnapshotCausalInconsistent
+		}
+		sess.snapshot = b
+		return nil
+	}
+}
+
+// NewClientSession creates a new ClientSession associated with the given Pool, client ID, and
+// SessionType.
+func NewClientSession(pool *Pool, clientID uuid.UUID, sessionType SessionType, opts ...ClientSessionOpt) (*ClientSession, error) {
+	server, err := pool.GetSession()
+	if err != nil {
+		return nil, err
+	}
+
+	sess := &ClientSession{
+		ClientID:    clientID,
+		pool:        pool,
+		server:      server,
+		SessionType: sessionType,
+		SessionID:   server.SessionID,
+	}
+
+	for _, opt := range opts {
+		if opt == nil {
+			continue
+		}
+
+		err := opt(sess)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return sess, nil
+}
+
+// AdvanceClusterTime updates the session's cluster time to the given cluster time if it is
+// greater than the session's current cluster time.
+func (c *ClientSession) AdvanceClusterTime(clusterTime *bson.Document) error {
+	if c.Terminated {
+		return ErrSessionEnded
+	}
+	c.ClusterTime = MaxClusterTime(c.ClusterTime, clusterTime)
+	return nil
+}
+
+// AdvanceOperationTime updates the session's operation time to the given operation time if it is
+// greater than the session's current operation time.
+func (c *ClientSession) AdvanceOperationTime(opTime *bson.Timestamp) error {
+	if c.Terminated {
+		return ErrSessionEnded
+	}
+
+	if c.OperationTime == nil || opTime.T > c.OperationTime.T ||
+		(opTime.T == c.OperationTime.T && opTime.I > c.OperationTime.I) {
+		c.OperationTime = opTime
+	}
+
+	return nil
+}
+
+// UpdateUseTime updates the session's last-used time, which the session pool consults when
+// deciding whether a session has gone stale.
+func (c *ClientSession) UpdateUseTime() error {
+	if c.Terminated {
+		return ErrSessionEnded
+	}
+	c.server.LastUsed = time.Now()
+	return nil
+}
+
+// EndSessionContext terminates the session, returning the underlying server session to the pool.
+// ctx is stored on the server session, and if ctx had already been canceled at the moment the
+// session was ended, the pool discards the server session instead of handing it back out for
+// reuse. The pool does not send endSessions itself, so nothing here applies ctx to that command.
+func (c *ClientSession) EndSessionContext(ctx context.Context) {
+	if c.Terminated {
+		return
+	}
+	c.Terminated = true
+	c.server.LastCtx = ctx
+	c.server.LastCtxCanceled = ctx.Err() != nil
+	c.pool.ReturnSession(c.server)
+}
+
+// EndSession terminates the session, returning the underlying server session to the pool. It is
+// equivalent to calling EndSessionContext with context.Background().
+func (c *ClientSession) EndSession() {
+	c.EndSessionContext(context.Background())
+}
+
+// TransactionRunning returns true if the session currently has a transaction in the starting or
+// in-progress state.
+func (c *ClientSession) TransactionRunning() bool {
+	return c.state == Starting || c.state == InProgress
+}
+
+// TransactionCommitted returns true if the session's transaction has been committed.
+func (c *ClientSession) TransactionCommitted() bool {
+	return c.state == Committed
+}
+
+// TransactionAborted returns true if the session's transaction has been aborted.
+func (c *ClientSession) TransactionAborted() bool {
+	return c.state == Aborted
+}
+
+// StartTransaction initializes a transaction on the session, returning an error if one is already
+// in progress or if the effective write concern (the previous transaction's options, unless
+// cleared by ClearTransactionOpts, merged with opts) is unacknowledged, since unacknowledged
+// writes aren't supported inside a transaction.
+func (c *ClientSession) StartTransaction(opts ...TransactionOption) error {
+	if c.TransactionRunning() {
+		return ErrTransactInProgress
+	}
+
+	merged := mergeTransactionOptions(c.transactionOpts, opts...)
+	if merged.WriteConcern != nil && !merged.WriteConcern.Acknowledged() {
+		return ErrUnackWCUnsupported
+	}
+
+	c.TxnNumber++
+	c.state = Starting
+	c.RecoveryToken = nil
+	c.transactionOpts = merged
+	return nil
+}
+
+// ApplyCommand advances the transaction FSM from Starting to InProgress and records that a
+// command has been sent as part of the in-progress transaction, if any.
+func (c *ClientSession) ApplyCommand() {
+	if c.state == Starting {
+		c.state = InProgress
+	}
+}
+
+// PinMongos pins the session to server and conn if this is the first command of a transaction
+// running against a mongos, since every later command in a sharded transaction must keep going to
+// that same mongos. It must be called before ApplyCommand advances the transaction out of the
+// Starting state, and is a no-op for unsharded topologies or once a server is already pinned.
+func (c *ClientSession) PinMongos(server *description.Server, conn connection.Connection) {
+	if c.state != Starting || c.PinnedServer != nil {
+		return
+	}
+	if server == nil || server.Kind != description.Mongos {
+		return
+	}
+
+	c.PinnedServer = server
+	c.PinnedConnection = conn
+}
+
+// CommitTransactionContext transitions the session's transaction into the committed state,
+// honoring ctx's cancellation/deadline when the commitTransaction command is eventually flushed.
+// If ctx is already done, it returns ErrSessionOperationCanceled and leaves the transaction state
+// machine untouched, so the caller can retry or abort instead.
+func (c *ClientSession) CommitTransactionContext(ctx context.Context) error {
+	if c.state == None {
+		return ErrNoTransactStarted
+	}
+	if c.state == Aborted {
+		return ErrCommitAfterAbort
+	}
+
+	c.server.LastCtx = ctx
+	c.server.LastCtxCanceled = ctx.Err() != nil
+	if c.server.LastCtxCanceled {
+		return ErrSessionOperationCanceled
+	}
+
+	c.state = Committed
+	return nil
+}
+
+// CommitTransaction transitions the session's transaction into the committed state. It is
+// equivalent to calling CommitTransactionContext with context.Background().
+func (c *ClientSession) CommitTransaction() error {
+	return c.CommitTransactionContext(context.Background())
+}
+
+// AbortTransactionContext transitions the session's transaction into the aborted state, honoring
+// ctx's cancellation/deadline when the abortTransaction command is eventually flushed. If ctx is
+// already done, it returns ErrSessionOperationCanceled and leaves the transaction state machine
+// untouched.
+func (c *ClientSession) AbortTransactionContext(ctx context.Context) error {
+	if c.state == None {
+		return ErrNoTransactStarted
+	}
+	if c.state == Committed {
+		return ErrAbortAfterCommit
+	}
+	if c.state == Aborted {
+		return ErrAbortTwice
+	}
+
+	c.server.LastCtx = ctx
+	c.server.LastCtxCanceled = ctx.Err() != nil
+	if c.server.LastCtxCanceled {
+		return ErrSessionOperationCanceled
+	}
+
+	c.state = Aborted
+	return nil
+}
+
+// AbortTransaction transitions the session's transaction into the aborted state. It is equivalent
+// to calling AbortTransactionContext with context.Background().
+func (c *ClientSession) AbortTransaction() error {
+	return c.AbortTransactionContext(context.Background())
+}
+
+// ClearTransactionOpts resets the transaction options and pinned server/connection state, so that
+// the next StartTransaction starts from a clean slate. CommitTransaction and AbortTransaction do
+// not call it; until it is called, the next StartTransaction merges opts over the options of the
+// previous transaction.
+func (c *ClientSession) ClearTransactionOpts() {
+	c.transactionOpts = nil
+	c.PinnedServer = nil
+	c.PinnedConnection = nil
+}
+
+// TransactionOpts returns the options in effect for the session's current (or most recently
+// started) transaction.
+func (c *ClientSession) TransactionOpts() *TransactionOptions {
+	return c.transactionOpts
+}
+
+// UpdateRecoveryToken records the recoveryToken returned by the server for a sharded transaction.
+func (c *ClientSession) UpdateRecoveryToken(token *bson.Document) {
+	if token == nil {
+		return
+	}
+	c.RecoveryToken = token
+}
+
+// AppendTransactionFields appends the transaction-related fields (startTransaction, autocommit,
+// txnNumber, and recoveryToken, as applicable) to cmd for the current transaction state.
+func (c *ClientSession) AppendTransactionFields(cmd *bson.Document) *bson.Document {
+	if c.state == None {
+		return cmd
+	}
+
+	if c.state == Starting {
+		cmd.Append(bson.EC.Boolean("startTransaction", true))
+	}
+
+	cmd.Append(
+		bson.EC.Boolean("autocommit", false),
+		bson.EC.Int64("txnNumber", c.TxnNumber),
+	)
+
+	if c.RecoveryToken != nil {
+		cmd.Append(bson.EC.SubDocument("recoveryToken", c.RecoveryToken))
+	}
+
+	return cmd
+}
+
+// IsSnapshot returns true if the session was created with OptSnapshot(true).
+func (c *ClientSession) IsSnapshot() bool {
+	return c.snapshot
+}
+
+// SnapshotTime returns the atClusterTime pinned by the session's first read, or nil if the
+// session isn't a snapshot session or hasn't performed a read yet.
+func (c *ClientSession) SnapshotTime() *bson.Timestamp {
+	return c.snapshotTime
+}
+
+// SetSnapshotTime pins the session's snapshot time to ts if it isn't already set. Subsequent
+// calls are no-ops: once a snapshot session has read, its atClusterTime is fixed for the rest of
+// the session.
+func (c *ClientSession) SetSnapshotTime(ts *bson.Timestamp) {
+	if !c.snapshot || c.snapshotTime != nil || ts == nil {
+		return
+	}
+	c.snapshotTime = ts
+}
+
+// ValidateWriteAllowed returns ErrSnapshotWriteNotAllowed if the session is a snapshot session, as
+// writes are not permitted on a snapshot session. It returns nil for every other session.
+func (c *ClientSession) ValidateWriteAllowed() error {
+	if c.snapshot {
+		return ErrSnapshotWriteNotAllowed
+	}
+	return nil
+}
+
+// AppendSnapshotReadConcern appends a snapshot read concern, pinned to the session's
+// SnapshotTime, to cmd. It is a no-op for sessions that aren't snapshot sessions or that haven't
+// pinned a snapshot time yet.
+func (c *ClientSession) AppendSnapshotReadConcern(cmd *bson.Document) *bson.Document {
+	if !c.snapshot || c.snapshotTime == nil {
+		return cmd
+	}
+
+	rc := bson.NewDocument(
+		bson.EC.String("level", "snapshot"),
+		bson.EC.Timestamp("atClusterTime", c.snapshotTime.T, c.snapshotTime.I),
+	)
+	cmd.Append(bson.EC.SubDocument("readConcern", rc))
+	return cmd
+}
+
+// MaxClusterTime compares the two given cluster times and returns the one that is the most
+// recent, or ct1 if they are equal.
+func MaxClusterTime(ct1, ct2 *bson.Document) *bson.Document {
+	if ct1 == nil {
+		return ct2
+	}
+	if ct2 == nil {
+		return ct1
+	}
+
+	val1, err := ct1.LookupErr("$clusterTime", "clusterTime")
+	if err != nil {
+		return ct2
+	}
+
+	val2, err := ct2.LookupErr("$clusterTime", "clusterTime")
+	if err != nil {
+		return ct1
+	}
+
+	t1, i1 := val1.Timestamp()
+	t2, i2 := val2.Timestamp()
+
+	if t1 > t2 || (t1 == t2 && i1 >= i2) {
+		return ct1
+	}
+	return ct2
+}
@@ -1,10 +1,13 @@
 package session
 
 import (
+	"context"
 	"testing"
 
 	"github.com/mongodb/mongo-go-driver/bson"
+	"github.com/mongodb/mongo-go-driver/core/description"
 	"github.com/mongodb/mongo-go-driver/core/uuid"
+	"github.com/mongodb/mongo-go-driver/core/writeconcern"
 	"github.com/mongodb/mongo-go-driver/internal/testutil/helpers"
 	"github.com/stretchr/testify/require"
 )
@@ -181,4 +184,235 @@ func TestClientSession(t *testing.T) {
 			t.Errorf("expected error, got %v", err)
 		}
 	})
+
+	t.Run("TestStartTransactionUnacknowledgedWriteConcern", func(t *testing.T) {
+		id, _ := uuid.New()
+		sess, err := NewClientSession(&Pool{}, id, Explicit)
+		require.Nil(t, err, "Unexpected error")
+
+		err = sess.StartTransaction(OptTransactionWriteConcern(writeconcern.New(writeconcern.W(0))))
+		if err != ErrUnackWCUnsupported {
+			t.Errorf("expected ErrUnackWCUnsupported, got %v", err)
+		}
+		if sess.TransactionRunning() {
+			t.Errorf("expected a rejected StartTransaction to leave no transaction running")
+		}
+
+		err = sess.StartTransaction(OptTransactionWriteConcern(writeconcern.New(writeconcern.WMajority())))
+		require.Nil(t, err, "error starting transaction with an acknowledged write concern: %s", err)
+	})
+
+	t.Run("TestPinMongos", func(t *testing.T) {
+		id, _ := uuid.New()
+		sess, err := NewClientSession(&Pool{}, id, Explicit)
+		require.Nil(t, err, "Unexpected error")
+
+		mongos := &description.Server{Kind: description.Mongos}
+
+		sess.PinMongos(mongos, nil)
+		if sess.PinnedServer != nil {
+			t.Errorf("expected no pin outside of a transaction")
+		}
+
+		err = sess.StartTransaction()
+		require.Nil(t, err, "error starting transaction: %s", err)
+
+		sess.PinMongos(&description.Server{Kind: description.RSPrimary}, nil)
+		if sess.PinnedServer != nil {
+			t.Errorf("expected no pin against a non-mongos server")
+		}
+
+		sess.PinMongos(mongos, nil)
+		if sess.PinnedServer != mongos {
+			t.Errorf("expected the session to pin to the mongos used for the first command")
+		}
+
+		sess.ApplyCommand()
+		sess.PinMongos(&description.Server{Kind: description.Mongos}, nil)
+		if sess.PinnedServer != mongos {
+			t.Errorf("expected the pinned server to stick once the transaction is in progress")
+		}
+
+		sess.ClearTransactionOpts()
+		if sess.PinnedServer != nil {
+			t.Errorf("expected ClearTransactionOpts to unpin the server")
+		}
+	})
+
+	t.Run("TestAppendTransactionFields", func(t *testing.T) {
+		id, _ := uuid.New()
+		sess, err := NewClientSession(&Pool{}, id, Explicit)
+		require.Nil(t, err, "Unexpected error")
+
+		cmd := bson.NewDocument(bson.EC.String("ping", "1"))
+		cmd = sess.AppendTransactionFields(cmd)
+		if cmd.Lookup("autocommit") != nil {
+			t.Errorf("expected no transaction fields outside of a transaction")
+		}
+
+		err = sess.StartTransaction()
+		require.Nil(t, err, "error starting transaction: %s", err)
+
+		cmd = bson.NewDocument(bson.EC.String("insert", "coll"))
+		cmd = sess.AppendTransactionFields(cmd)
+		startVal, err := cmd.LookupErr("startTransaction")
+		require.Nil(t, err, "expected startTransaction field on first command of transaction")
+		if !startVal.Boolean() {
+			t.Errorf("expected startTransaction to be true")
+		}
+		txnNumVal, err := cmd.LookupErr("txnNumber")
+		require.Nil(t, err, "expected txnNumber field")
+		if txnNumVal.Int64() != sess.TxnNumber {
+			t.Errorf("txnNumber mismatch; expected %d, got %d", sess.TxnNumber, txnNumVal.Int64())
+		}
+
+		sess.ApplyCommand()
+		cmd = bson.NewDocument(bson.EC.String("find", "coll"))
+		cmd = sess.AppendTransactionFields(cmd)
+		if cmd.Lookup("startTransaction") != nil {
+			t.Errorf("expected no startTransaction field after the first command of a transaction")
+		}
+	})
+
+	t.Run("TestCommitTransactionContextCanceled", func(t *testing.T) {
+		id, _ := uuid.New()
+		pool := NewPool(0)
+		sess, err := NewClientSession(pool, id, Explicit)
+		require.Nil(t, err, "Unexpected error")
+
+		err = sess.StartTransaction()
+		require.Nil(t, err, "error starting transaction: %s", err)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		err = sess.CommitTransactionContext(ctx)
+		if err != ErrSessionOperationCanceled {
+			t.Errorf("expected ErrSessionOperationCanceled, got %v", err)
+		}
+		if sess.state != Starting {
+			t.Errorf("expected canceled commit to leave the state machine unchanged, got %v", sess.state)
+		}
+
+		err = sess.CommitTransaction()
+		require.Nil(t, err, "error committing transaction: %s", err)
+		if sess.state != Committed {
+			t.Errorf("incorrect session state, expected Committed, received %v", sess.state)
+		}
+	})
+
+	t.Run("TestCommitAbortTransactionContextCanceledWithNoTransaction", func(t *testing.T) {
+		id, _ := uuid.New()
+		pool := NewPool(0)
+		sess, err := NewClientSession(pool, id, Explicit)
+		require.Nil(t, err, "Unexpected error")
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		err = sess.CommitTransactionContext(ctx)
+		if err != ErrNoTransactStarted {
+			t.Errorf("expected ErrNoTransactStarted to take priority over a canceled context, got %v", err)
+		}
+
+		err = sess.AbortTransactionContext(ctx)
+		if err != ErrNoTransactStarted {
+			t.Errorf("expected ErrNoTransactStarted to take priority over a canceled context, got %v", err)
+		}
+	})
+
+	t.Run("TestAbortTransactionContextCanceled", func(t *testing.T) {
+		id, _ := uuid.New()
+		pool := NewPool(0)
+		sess, err := NewClientSession(pool, id, Explicit)
+		require.Nil(t, err, "Unexpected error")
+
+		err = sess.StartTransaction()
+		require.Nil(t, err, "error starting transaction: %s", err)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		err = sess.AbortTransactionContext(ctx)
+		if err != ErrSessionOperationCanceled {
+			t.Errorf("expected ErrSessionOperationCanceled, got %v", err)
+		}
+		if sess.state != Starting {
+			t.Errorf("expected canceled abort to leave the state machine unchanged, got %v", sess.state)
+		}
+
+		err = sess.AbortTransaction()
+		require.Nil(t, err, "error aborting transaction: %s", err)
+		if sess.state != Aborted {
+			t.Errorf("incorrect session state, expected Aborted, received %v", sess.state)
+		}
+	})
+
+	t.Run("TestEndSessionContextStoresCanceledCtxForEviction", func(t *testing.T) {
+		id, _ := uuid.New()
+		pool := NewPool(0)
+		sess, err := NewClientSession(pool, id, Explicit)
+		require.Nil(t, err, "Unexpected error")
+
+		ss := sess.server
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		sess.EndSessionContext(ctx)
+		if ss.LastCtx != ctx {
+			t.Errorf("expected the server session to record the context passed to EndSessionContext")
+		}
+
+		got, err := pool.GetSession()
+		require.Nil(t, err, "error getting session: %s", err)
+		if got == ss {
+			t.Errorf("expected session returned with a canceled context to be evicted rather than reused")
+		}
+	})
+
+	t.Run("TestSnapshot", func(t *testing.T) {
+		t.Run("PinnedAfterFirstResponse", func(t *testing.T) {
+			id, _ := uuid.New()
+			sess, err := NewClientSession(&Pool{}, id, Explicit, OptSnapshot(true))
+			require.Nil(t, err, "Unexpected error")
+
+			if sess.SnapshotTime() != nil {
+				t.Errorf("expected no snapshot time before the first read")
+			}
+
+			first := &bson.Timestamp{T: 10, I: 1}
+			sess.SetSnapshotTime(first)
+			if sess.SnapshotTime() != first {
+				t.Errorf("expected snapshot time to be pinned to the first response")
+			}
+
+			sess.SetSnapshotTime(&bson.Timestamp{T: 20, I: 1})
+			if sess.SnapshotTime() != first {
+				t.Errorf("expected snapshot time to remain unchanged by later reads")
+			}
+		})
+
+		t.Run("WritesNotAllowed", func(t *testing.T) {
+			id, _ := uuid.New()
+			sess, err := NewClientSession(&Pool{}, id, Explicit, OptSnapshot(true))
+			require.Nil(t, err, "Unexpected error")
+
+			if err := sess.ValidateWriteAllowed(); err != ErrSnapshotWriteNotAllowed {
+				t.Errorf("expected ErrSnapshotWriteNotAllowed, got %v", err)
+			}
+		})
+
+		t.Run("CausalConsistencyMutuallyExclusive", func(t *testing.T) {
+			id, _ := uuid.New()
+			_, err := NewClientSession(&Pool{}, id, Explicit, OptCausalConsistency(true), OptSnapshot(true))
+			if err != ErrSnapshotCausalInconsistent {
+				t.Errorf("expected ErrSnapshotCausalInconsistent, got %v", err)
+			}
+
+			_, err = NewClientSession(&Pool{}, id, Explicit, OptSnapshot(true), OptCausalConsistency(true))
+			if err != ErrSnapshotCausalInconsistent {
+				t.Errorf("expected ErrSnapshotCausalInconsistent, got %v", err)
+			}
+		})
+	})
 }
@@ -0,0 +1,123 @@
+package session
+
+import (
+	"time"
+
+	"github.com/mongodb/mongo-go-driver/bson"
+	"github.com/mongodb/mongo-go-driver/core/connection"
+	"github.com/mongodb/mongo-go-driver/core/description"
+)
+
+// CommandStartedEvent represents an event generated when a command is sent to a server.
+type CommandStartedEvent struct {
+	CommandName  string
+	DatabaseName string
+	Command      *bson.Document
+	RequestID    int64
+	ConnectionID string
+	LsID         *bson.Document
+	TxnNumber    int64
+}
+
+// CommandSucceededEvent represents an event generated when a command's execution succeeds.
+type CommandSucceededEvent struct {
+	CommandName   string
+	DatabaseName  string
+	Reply         *bson.Document
+	RequestID     int64
+	ConnectionID  string
+	DurationNanos int64
+}
+
+// CommandFailedEvent represents an event generated when a command's execution fails.
+type CommandFailedEvent struct {
+	CommandName   string
+	DatabaseName  string
+	Failure       error
+	RequestID     int64
+	ConnectionID  string
+	DurationNanos int64
+}
+
+// Monitor is implemented by types that want to observe the commands a ClientSession sends, e.g.
+// to plug in an APM or metrics integration without patching the driver itself. Implementations
+// must not block, since they are invoked on the hot path of every command.
+type Monitor interface {
+	Started(*CommandStartedEvent)
+	Succeeded(*CommandSucceededEvent)
+	Failed(*CommandFailedEvent)
+}
+
+// OptMonitor attaches a Monitor to the session so that it's notified of every command the session
+// sends.
+func OptMonitor(m Monitor) ClientSessionOpt {
+	return func(sess *ClientSession) error {
+		sess.monitor = m
+		return nil
+	}
+}
+
+// currentTxnNumber returns the TxnNumber to report on an event, which is only meaningful while a
+// transaction is running.
+func (c *ClientSession) currentTxnNumber() int64 {
+	if c.TransactionRunning() {
+		return c.TxnNumber
+	}
+	return 0
+}
+
+// CommandStarted refreshes the session's last-used time so the pool doesn't treat an
+// actively-used session as stale, pins the session to server/conn if cmd is the first command of
+// a sharded transaction, advances the transaction state machine for the outgoing command via
+// ApplyCommand, and, if a Monitor is configured, notifies it that cmd is about to be sent.
+func (c *ClientSession) CommandStarted(cmdName, dbName string, cmd *bson.Document, requestID int64, connID string, server *description.Server, conn connection.Connection) {
+	_ = c.UpdateUseTime()
+	c.PinMongos(server, conn)
+	c.ApplyCommand()
+
+	if c.monitor == nil {
+		return
+	}
+
+	c.monitor.Started(&CommandStartedEvent{
+		CommandName:  cmdName,
+		DatabaseName: dbName,
+		Command:      cmd,
+		RequestID:    requestID,
+		ConnectionID: connID,
+		LsID:         c.SessionID,
+		TxnNumber:    c.currentTxnNumber(),
+	})
+}
+
+// CommandSucceeded notifies the session's Monitor, if any, that cmdName succeeded.
+func (c *ClientSession) CommandSucceeded(cmdName, dbName string, reply *bson.Document, requestID int64, connID string, duration time.Duration) {
+	if c.monitor == nil {
+		return
+	}
+
+	c.monitor.Succeeded(&CommandSucceededEvent{
+		CommandName:   cmdName,
+		DatabaseName:  dbName,
+		Reply:         reply,
+		RequestID:     requestID,
+		ConnectionID:  connID,
+		DurationNanos: duration.Nanoseconds(),
+	})
+}
+
+// CommandFailed notifies the session's Monitor, if any, that cmdName failed with err.
+func (c *ClientSession) CommandFailed(cmdName, dbName string, err error, requestID int64, connID string, duration time.Duration) {
+	if c.monitor == nil {
+		return
+	}
+
+	c.monitor.Failed(&CommandFailedEvent{
+		CommandName:   cmdName,
+		DatabaseName:  dbName,
+		Failure:       err,
+		RequestID:     requestID,
+		ConnectionID:  connID,
+		DurationNanos: duration.Nanoseconds(),
+	})
+}
@@ -0,0 +1,97 @@
+package session
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mongodb/mongo-go-driver/bson"
+	"github.com/mongodb/mongo-go-driver/core/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+// recordingMonitor is an in-memory Monitor that records the order and name of every event it
+// receives, for use in assertions.
+type recordingMonitor struct {
+	events []string
+}
+
+func (m *recordingMonitor) Started(e *CommandStartedEvent) {
+	m.events = append(m.events, "started:"+e.CommandName)
+}
+
+func (m *recordingMonitor) Succeeded(e *CommandSucceededEvent) {
+	m.events = append(m.events, "succeeded:"+e.CommandName)
+}
+
+func (m *recordingMonitor) Failed(e *CommandFailedEvent) {
+	m.events = append(m.events, "failed:"+e.CommandName)
+}
+
+func TestMonitor(t *testing.T) {
+	t.Run("TestTransactionEventOrdering", func(t *testing.T) {
+		mon := &recordingMonitor{}
+		id, _ := uuid.New()
+		sess, err := NewClientSession(&Pool{}, id, Explicit, OptMonitor(mon))
+		require.Nil(t, err, "Unexpected error")
+
+		err = sess.StartTransaction()
+		require.Nil(t, err, "error starting transaction: %s", err)
+
+		cmd := bson.NewDocument(bson.EC.String("insert", "coll"))
+		sess.CommandStarted("insert", "db", cmd, 1, "conn1", nil, nil)
+		if sess.state != InProgress {
+			t.Errorf("expected CommandStarted to advance the transaction to InProgress")
+		}
+		sess.CommandSucceeded("insert", "db", bson.NewDocument(bson.EC.Int32("ok", 1)), 1, "conn1", 0)
+
+		err = sess.CommitTransaction()
+		require.Nil(t, err, "error committing transaction: %s", err)
+
+		expected := []string{"started:insert", "succeeded:insert"}
+		if len(mon.events) != len(expected) {
+			t.Fatalf("expected events %v, got %v", expected, mon.events)
+		}
+		for i, e := range expected {
+			if mon.events[i] != e {
+				t.Errorf("expected event %d to be %q, got %q", i, e, mon.events[i])
+			}
+		}
+	})
+
+	t.Run("TestCommandFailed", func(t *testing.T) {
+		mon := &recordingMonitor{}
+		id, _ := uuid.New()
+		sess, err := NewClientSession(&Pool{}, id, Explicit, OptMonitor(mon))
+		require.Nil(t, err, "Unexpected error")
+
+		cmd := bson.NewDocument(bson.EC.String("find", "coll"))
+		sess.CommandStarted("find", "db", cmd, 2, "conn1", nil, nil)
+		sess.CommandFailed("find", "db", ErrSessionEnded, 2, "conn1", 0)
+
+		expected := []string{"started:find", "failed:find"}
+		if len(mon.events) != len(expected) {
+			t.Fatalf("expected events %v, got %v", expected, mon.events)
+		}
+		for i, e := range expected {
+			if mon.events[i] != e {
+				t.Errorf("expected event %d to be %q, got %q", i, e, mon.events[i])
+			}
+		}
+	})
+
+	t.Run("TestCommandStartedRefreshesUseTime", func(t *testing.T) {
+		id, _ := uuid.New()
+		sess, err := NewClientSession(&Pool{}, id, Explicit)
+		require.Nil(t, err, "Unexpected error")
+
+		stale := time.Now().Add(-time.Hour)
+		sess.server.LastUsed = stale
+
+		cmd := bson.NewDocument(bson.EC.String("find", "coll"))
+		sess.CommandStarted("find", "db", cmd, 1, "conn1", nil, nil)
+
+		if !sess.server.LastUsed.After(stale) {
+			t.Errorf("expected CommandStarted to refresh LastUsed, got %v", sess.server.LastUsed)
+		}
+	})
+}
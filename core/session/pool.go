@@ -0,0 +1,200 @@
+package session
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+
+	"github.com/mongodb/mongo-go-driver/bson"
+	"github.com/mongodb/mongo-go-driver/core/uuid"
+)
+
+// endSessionsBatchSize is the maximum number of session IDs the server will accept in a single
+// endSessions command.
+const endSessionsBatchSize = 10000
+
+// serverSession represents a server session that backs a ClientSession. It tracks the identifier
+// the server uses to associate commands with the session and when it was last used, so the pool
+// can decide whether it's safe to reuse.
+type serverSession struct {
+	SessionID *bson.Document
+	LastUsed  time.Time
+
+	// LastCtx is the context passed to the most recent *Context method called on the owning
+	// ClientSession, kept so that code flushing a command tied to this session (e.g. endSessions)
+	// can honor its cancellation/deadline.
+	LastCtx context.Context
+
+	// LastCtxCanceled records whether LastCtx had already been canceled or had passed its
+	// deadline at the moment it was set, rather than re-checking ctx.Err() later: a context from
+	// a completed, successful operation is routinely canceled afterwards via `defer cancel()`, and
+	// that shouldn't retroactively mark the session unsafe to reuse.
+	LastCtxCanceled bool
+}
+
+// newServerSession creates a server session with a freshly generated ID.
+func newServerSession() (*serverSession, error) {
+	id, err := uuid.New()
+	if err != nil {
+		return nil, err
+	}
+
+	return &serverSession{
+		SessionID: bson.NewDocument(bson.EC.Binary("id", id[:])),
+		LastUsed:  time.Now(),
+	}, nil
+}
+
+// expired returns true if this session is within one minute of the server's
+// logicalSessionTimeoutMinutes and should not be reused, or if its last operation was already
+// canceled or past its deadline when it ran. A timeoutMinutes of 0 means the server does not
+// expire sessions on its own, but a canceled LastCtx still forces eviction.
+func (ss *serverSession) expired(timeoutMinutes uint32) bool {
+	if ss.LastCtxCanceled {
+		return true
+	}
+
+	if timeoutMinutes == 0 {
+		return false
+	}
+
+	return time.Since(ss.LastUsed).Minutes() > float64(timeoutMinutes-1)
+}
+
+// Pool is a pool of serverSessions that ClientSessions check out from and return to, so that
+// server sessions can be reused across the lifetime of a Client rather than creating a new one
+// for every logical session. Sessions are handed out LIFO, so the most recently used session
+// stays hot, and sessions that have gone stale are evicted as they're encountered. The zero value
+// is a usable pool with no session timeout.
+type Pool struct {
+	timeoutMinutes uint32
+
+	mu         sync.Mutex
+	sessions   *list.List
+	checkedOut int
+	ended      []*bson.Document
+}
+
+// NewPool creates a session pool that evicts sessions that are within one minute of the given
+// logicalSessionTimeoutMinutes, as reported by the topology.
+func NewPool(logicalSessionTimeoutMinutes uint32) *Pool {
+	return &Pool{
+		timeoutMinutes: logicalSessionTimeoutMinutes,
+		sessions:       list.New(),
+	}
+}
+
+// GetSession returns a cached serverSession if one is available and not stale, evicting any stale
+// sessions it encounters along the way. Otherwise, it creates a new one.
+func (p *Pool) GetSession() (*serverSession, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.sessions == nil {
+		p.sessions = list.New()
+	}
+
+	for {
+		elem := p.sessions.Front()
+		if elem == nil {
+			break
+		}
+		p.sessions.Remove(elem)
+
+		ss := elem.Value.(*serverSession)
+		if !ss.expired(p.timeoutMinutes) {
+			p.checkedOut++
+			return ss, nil
+		}
+	}
+
+	ss, err := newServerSession()
+	if err != nil {
+		return nil, err
+	}
+
+	p.checkedOut++
+	return ss, nil
+}
+
+// ReturnSession returns a serverSession to the pool so it can be reused by a later ClientSession.
+// If the session has gone stale it is discarded and queued up to be included in the next
+// endSessions batch instead.
+func (p *Pool) ReturnSession(ss *serverSession) {
+	if ss == nil {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.checkedOut--
+
+	if ss.expired(p.timeoutMinutes) {
+		p.ended = append(p.ended, ss.SessionID)
+		return
+	}
+
+	ss.LastUsed = time.Now()
+	if p.sessions == nil {
+		p.sessions = list.New()
+	}
+	p.sessions.PushFront(ss)
+
+	// Evict anything at the back of the list that's gone stale while it was sitting there.
+	for {
+		elem := p.sessions.Back()
+		if elem == nil {
+			break
+		}
+		if !elem.Value.(*serverSession).expired(p.timeoutMinutes) {
+			break
+		}
+		p.sessions.Remove(elem)
+		p.ended = append(p.ended, elem.Value.(*serverSession).SessionID)
+	}
+}
+
+// CheckedOut returns the number of sessions currently checked out of the pool, for diagnostics.
+func (p *Pool) CheckedOut() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.checkedOut
+}
+
+// EndSessions drains every idle and stale-but-unreported session ID tracked by the pool and
+// groups them into batches no larger than endSessionsBatchSize, the shape the endSessions admin
+// command expects. The caller (Client.Disconnect) is responsible for actually sending each batch.
+func (p *Pool) EndSessions() [][]*bson.Document {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.sessions == nil {
+		p.sessions = list.New()
+	}
+
+	ids := p.ended
+	p.ended = nil
+
+	for elem := p.sessions.Front(); elem != nil; elem = elem.Next() {
+		ids = append(ids, elem.Value.(*serverSession).SessionID)
+	}
+	p.sessions.Init()
+
+	if len(ids) == 0 {
+		return nil
+	}
+
+	var batches [][]*bson.Document
+	for len(ids) > 0 {
+		size := endSessionsBatchSize
+		if size > len(ids) {
+			size = len(ids)
+		}
+		batches = append(batches, ids[:size])
+		ids = ids[size:]
+	}
+
+	return batches
+}
@@ -0,0 +1,94 @@
+package session
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPool(t *testing.T) {
+	t.Run("TestLIFO", func(t *testing.T) {
+		pool := NewPool(0)
+
+		first, err := pool.GetSession()
+		require.Nil(t, err, "error getting first session: %s", err)
+		second, err := pool.GetSession()
+		require.Nil(t, err, "error getting second session: %s", err)
+
+		pool.ReturnSession(first)
+		pool.ReturnSession(second)
+
+		got, err := pool.GetSession()
+		require.Nil(t, err, "error getting session: %s", err)
+		if got != second {
+			t.Errorf("expected LIFO reuse to return the most recently returned session")
+		}
+
+		got, err = pool.GetSession()
+		require.Nil(t, err, "error getting session: %s", err)
+		if got != first {
+			t.Errorf("expected LIFO reuse to return the first session next")
+		}
+	})
+
+	t.Run("TestStaleSessionEvictedOnCheckout", func(t *testing.T) {
+		pool := NewPool(30)
+
+		stale, err := pool.GetSession()
+		require.Nil(t, err, "error getting session: %s", err)
+		pool.ReturnSession(stale)
+		stale.LastUsed = time.Now().Add(-time.Hour)
+
+		got, err := pool.GetSession()
+		require.Nil(t, err, "error getting session: %s", err)
+		if got == stale {
+			t.Errorf("expected stale session to be evicted rather than reused")
+		}
+	})
+
+	t.Run("TestCheckedOut", func(t *testing.T) {
+		pool := NewPool(0)
+
+		ss, err := pool.GetSession()
+		require.Nil(t, err, "error getting session: %s", err)
+		if pool.CheckedOut() != 1 {
+			t.Errorf("expected 1 checked out session, got %d", pool.CheckedOut())
+		}
+
+		pool.ReturnSession(ss)
+		if pool.CheckedOut() != 0 {
+			t.Errorf("expected 0 checked out sessions, got %d", pool.CheckedOut())
+		}
+	})
+
+	t.Run("TestEndSessionsBatching", func(t *testing.T) {
+		pool := NewPool(0)
+
+		const numSessions = endSessionsBatchSize + 1
+		sessions := make([]*serverSession, numSessions)
+		for i := range sessions {
+			ss, err := pool.GetSession()
+			require.Nil(t, err, "error getting session: %s", err)
+			sessions[i] = ss
+		}
+		for _, ss := range sessions {
+			pool.ReturnSession(ss)
+		}
+
+		batches := pool.EndSessions()
+		if len(batches) != 2 {
+			t.Fatalf("expected 2 batches, got %d", len(batches))
+		}
+		if len(batches[0]) != endSessionsBatchSize {
+			t.Errorf("expected first batch to have %d ids, got %d", endSessionsBatchSize, len(batches[0]))
+		}
+		if len(batches[1]) != 1 {
+			t.Errorf("expected second batch to have 1 id, got %d", len(batches[1]))
+		}
+
+		if batches := pool.EndSessions(); batches != nil {
+			t.Errorf("expected no batches left after draining the pool, got %v", batches)
+		}
+	})
+}
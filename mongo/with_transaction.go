@@ -0,0 +1,161 @@
+package mongo
+
+import (
+	"context"
+	"time"
+
+	"github.com/mongodb/mongo-go-driver/core/session"
+)
+
+// transactionRetryTimeout is the maximum amount of time WithTransaction will keep retrying a
+// transaction or its commit before giving up and returning the last error encountered. It's a var
+// rather than a const so tests can shrink it to exercise the deadline without waiting 120s.
+var transactionRetryTimeout = 120 * time.Second
+
+// Error labels returned by the server (or synthesized by the driver) that tell WithTransaction
+// whether a failure is safe to retry.
+const (
+	transientTransactionErrorLabel      = "TransientTransactionError"
+	unknownTransactionCommitResultLabel = "UnknownTransactionCommitResult"
+)
+
+// errorLabeler is implemented by errors that carry server-provided error labels, such as
+// *command.Error.
+type errorLabeler interface {
+	HasErrorLabel(label string) bool
+}
+
+func hasErrorLabel(err error, label string) bool {
+	le, ok := err.(errorLabeler)
+	return ok && le.HasErrorLabel(label)
+}
+
+// Session is a MongoDB logical session, associated with a sequence of operations performed by an
+// application, that can be used to run multi-document transactions.
+type Session interface {
+	// StartTransaction starts a new transaction on the session, failing if one is already in
+	// progress.
+	StartTransaction(...session.TransactionOption) error
+	// CommitTransaction commits the active transaction for this session.
+	CommitTransaction(context.Context) error
+	// AbortTransaction aborts the active transaction for this session.
+	AbortTransaction(context.Context) error
+	// EndSession aborts any in-progress transaction and closes the session.
+	EndSession(context.Context)
+	// WithTransaction starts a transaction, runs fn, and commits it, retrying the whole
+	// transaction or just the commit when the server reports that it's safe to do so. It gives up
+	// and returns the last error once transactionRetryTimeout has elapsed.
+	WithTransaction(
+		ctx context.Context,
+		fn func(sessCtx SessionContext) (interface{}, error),
+		opts ...session.TransactionOption,
+	) (interface{}, error)
+
+	clientSession() *session.ClientSession
+}
+
+// SessionContext combines a Context and a Session, and is passed to the callback given to
+// Session.WithTransaction so that operations run inside the callback can be associated with the
+// transaction without explicitly threading the Session through.
+type SessionContext interface {
+	context.Context
+	Session
+}
+
+type sessionImpl struct {
+	*session.ClientSession
+}
+
+// newSessionWithClient wraps an existing core session.ClientSession as a mongo.Session.
+func newSessionWithClient(clientSession *session.ClientSession) Session {
+	return &sessionImpl{ClientSession: clientSession}
+}
+
+func (s *sessionImpl) clientSession() *session.ClientSession {
+	return s.ClientSession
+}
+
+func (s *sessionImpl) StartTransaction(opts ...session.TransactionOption) error {
+	return s.ClientSession.StartTransaction(opts...)
+}
+
+func (s *sessionImpl) CommitTransaction(ctx context.Context) error {
+	return s.ClientSession.CommitTransactionContext(ctx)
+}
+
+func (s *sessionImpl) AbortTransaction(ctx context.Context) error {
+	return s.ClientSession.AbortTransactionContext(ctx)
+}
+
+func (s *sessionImpl) EndSession(ctx context.Context) {
+	if s.ClientSession.TransactionRunning() {
+		_ = s.ClientSession.AbortTransactionContext(ctx)
+	}
+	s.ClientSession.EndSessionContext(ctx)
+}
+
+func (s *sessionImpl) WithTransaction(
+	ctx context.Context,
+	fn func(sessCtx SessionContext) (interface{}, error),
+	opts ...session.TransactionOption,
+) (interface{}, error) {
+	return withTransaction(ctx, s, fn, opts...)
+}
+
+// withTransaction implements the retry algorithm behind Session.WithTransaction, driving sess
+// purely through the Session interface so it can be exercised with a fake Session in tests.
+func withTransaction(
+	ctx context.Context,
+	sess Session,
+	fn func(sessCtx SessionContext) (interface{}, error),
+	opts ...session.TransactionOption,
+) (interface{}, error) {
+	deadline := time.Now().Add(transactionRetryTimeout)
+
+	for {
+		if err := sess.StartTransaction(opts...); err != nil {
+			return nil, err
+		}
+
+		res, err := fn(&sessionContext{Context: ctx, Session: sess})
+		if err != nil {
+			_ = sess.AbortTransaction(ctx)
+			if hasErrorLabel(err, transientTransactionErrorLabel) && time.Now().Before(deadline) {
+				continue
+			}
+			return nil, err
+		}
+
+		err = sess.CommitTransaction(ctx)
+		for err != nil && hasErrorLabel(err, unknownTransactionCommitResultLabel) && time.Now().Before(deadline) {
+			// The previous commit may have actually succeeded server-side, so retry just the
+			// commit rather than re-running fn and risking its side effects happening twice.
+			err = sess.CommitTransaction(ctx)
+		}
+		if err == nil {
+			return res, nil
+		}
+		if hasErrorLabel(err, transientTransactionErrorLabel) && time.Now().Before(deadline) {
+			continue
+		}
+		return nil, err
+	}
+}
+
+// sessionContext is the default SessionContext implementation, pairing a Context with the Session
+// that produced it.
+type sessionContext struct {
+	context.Context
+	Session
+}
+
+// WithTransaction is a package-level convenience wrapper that runs fn as a transaction on the
+// already-started session sess. It is equivalent to calling sess.WithTransaction directly.
+func WithTransaction(
+	ctx context.Context,
+	sess Session,
+	fn func(sessCtx SessionContext) (interface{}, error),
+	opts ...session.TransactionOption,
+) (interface{}, error) {
+	return sess.WithTransaction(ctx, fn, opts...)
+}
@@ -0,0 +1,165 @@
+package mongo
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/mongodb/mongo-go-driver/core/session"
+	"github.com/stretchr/testify/require"
+)
+
+// labeledError is a fake error that carries server-style error labels, for exercising
+// hasErrorLabel without depending on the command package.
+type labeledError struct {
+	labels []string
+}
+
+func (e *labeledError) Error() string {
+	return "labeled error"
+}
+
+func (e *labeledError) HasErrorLabel(label string) bool {
+	for _, l := range e.labels {
+		if l == label {
+			return true
+		}
+	}
+	return false
+}
+
+// fakeSession is a minimal Session implementation that records calls and returns scripted errors,
+// so withTransaction's retry behavior can be tested without a real server connection.
+type fakeSession struct {
+	startErr error
+
+	commitErrs []error // consumed one at a time, each remaining call after that returns nil
+
+	startCount  int
+	commitCount int
+	abortCount  int
+}
+
+func (s *fakeSession) StartTransaction(...session.TransactionOption) error {
+	s.startCount++
+	return s.startErr
+}
+
+func (s *fakeSession) CommitTransaction(context.Context) error {
+	idx := s.commitCount
+	s.commitCount++
+	if idx < len(s.commitErrs) {
+		return s.commitErrs[idx]
+	}
+	return nil
+}
+
+func (s *fakeSession) AbortTransaction(context.Context) error {
+	s.abortCount++
+	return nil
+}
+
+func (s *fakeSession) EndSession(context.Context) {}
+
+func (s *fakeSession) WithTransaction(
+	ctx context.Context,
+	fn func(sessCtx SessionContext) (interface{}, error),
+	opts ...session.TransactionOption,
+) (interface{}, error) {
+	return withTransaction(ctx, s, fn, opts...)
+}
+
+func (s *fakeSession) clientSession() *session.ClientSession {
+	return nil
+}
+
+func TestWithTransaction(t *testing.T) {
+	t.Run("RetriesWholeTransactionOnTransientError", func(t *testing.T) {
+		sess := &fakeSession{}
+
+		fnCalls := 0
+		res, err := withTransaction(context.Background(), sess, func(SessionContext) (interface{}, error) {
+			fnCalls++
+			if fnCalls == 1 {
+				return nil, &labeledError{labels: []string{transientTransactionErrorLabel}}
+			}
+			return "ok", nil
+		})
+
+		require.Nil(t, err, "unexpected error: %s", err)
+		require.Equal(t, "ok", res)
+		if fnCalls != 2 {
+			t.Errorf("expected fn to be called twice, got %d", fnCalls)
+		}
+		if sess.startCount != 2 {
+			t.Errorf("expected StartTransaction to be called twice, got %d", sess.startCount)
+		}
+		if sess.abortCount != 1 {
+			t.Errorf("expected AbortTransaction to be called once, got %d", sess.abortCount)
+		}
+	})
+
+	t.Run("RetriesCommitAloneOnUnknownCommitResult", func(t *testing.T) {
+		sess := &fakeSession{
+			commitErrs: []error{&labeledError{labels: []string{unknownTransactionCommitResultLabel}}},
+		}
+
+		fnCalls := 0
+		res, err := withTransaction(context.Background(), sess, func(SessionContext) (interface{}, error) {
+			fnCalls++
+			return "ok", nil
+		})
+
+		require.Nil(t, err, "unexpected error: %s", err)
+		require.Equal(t, "ok", res)
+		if fnCalls != 1 {
+			t.Errorf("expected fn to be called once; UnknownTransactionCommitResult must not re-run it, got %d calls", fnCalls)
+		}
+		if sess.startCount != 1 {
+			t.Errorf("expected StartTransaction to be called once, got %d", sess.startCount)
+		}
+		if sess.commitCount != 2 {
+			t.Errorf("expected CommitTransaction to be retried once, got %d calls", sess.commitCount)
+		}
+	})
+
+	t.Run("GivesUpAfterDeadline", func(t *testing.T) {
+		orig := transactionRetryTimeout
+		transactionRetryTimeout = 10 * time.Millisecond
+		defer func() { transactionRetryTimeout = orig }()
+
+		sess := &fakeSession{}
+		transientErr := &labeledError{labels: []string{transientTransactionErrorLabel}}
+
+		fnCalls := 0
+		_, err := withTransaction(context.Background(), sess, func(SessionContext) (interface{}, error) {
+			fnCalls++
+			time.Sleep(15 * time.Millisecond)
+			return nil, transientErr
+		})
+
+		if err != transientErr {
+			t.Errorf("expected the last TransientTransactionError to be returned once the deadline passes, got %v", err)
+		}
+		if fnCalls != 1 {
+			t.Errorf("expected fn to run once before the deadline gave up, got %d calls", fnCalls)
+		}
+	})
+
+	t.Run("GivesUpOnNonRetryableCommitError", func(t *testing.T) {
+		commitErr := errors.New("commit failed")
+		sess := &fakeSession{commitErrs: []error{commitErr}}
+
+		_, err := withTransaction(context.Background(), sess, func(SessionContext) (interface{}, error) {
+			return "ok", nil
+		})
+
+		if err != commitErr {
+			t.Errorf("expected unlabeled commit error to be returned without retrying, got %v", err)
+		}
+		if sess.commitCount != 1 {
+			t.Errorf("expected CommitTransaction to be called once, got %d", sess.commitCount)
+		}
+	})
+}